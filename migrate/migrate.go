@@ -0,0 +1,169 @@
+// Package migrate applies versioned schema changes to a Mongo collection,
+// modeled on mender's numbered migration_X_Y_Z pattern: each Migration is an
+// idempotent-from-scratch step identified by an increasing Version, and the
+// highest applied Version is recorded so re-running a Migrator only applies
+// what's new.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	migrationsCollectionName = "schema_migrations"
+	locksCollectionName      = "schema_migration_locks"
+	lockTTL                  = time.Minute
+	lockPollInterval         = 200 * time.Millisecond
+)
+
+// Migration is one numbered step in a collection's schema history. Up must
+// be safe to run against a collection already at Version-1, and Migrations
+// are applied in ascending Version order.
+type Migration struct {
+	Version int64
+	Up      func(ctx context.Context, collection *mongo.Collection) error
+}
+
+// Migrator applies an ordered list of Migrations to a single (dbName, cName)
+// collection, recording the highest applied version in the
+// schema_migrations collection so Run is safe to call on every startup.
+type Migrator struct {
+	client     *mongo.Client
+	dbName     string
+	cName      string
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the given collection. migrations need
+// not be sorted; Run applies them in ascending Version order.
+func NewMigrator(client *mongo.Client, dbName, cName string, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	return &Migrator{client: client, dbName: dbName, cName: cName, migrations: sorted}
+}
+
+// Run acquires an advisory lock scoped to this collection (Mongo has no
+// native advisory lock, so a unique insert into schema_migration_locks
+// stands in for one), waiting out any other instance that's migrating the
+// same collection concurrently, then applies every Migration whose Version
+// is greater than the currently recorded version, in order, recording
+// progress after each step so a crash mid-run resumes rather than
+// re-applying completed migrations. A replica that loses the race for the
+// lock simply waits its turn and then finds the version already current,
+// so it's normal and not an error for every replica in a rolling deployment
+// to call Run concurrently at startup.
+func (m *Migrator) Run(ctx context.Context) error {
+	if err := m.acquireLock(ctx); err != nil {
+		return err
+	}
+	defer m.releaseLock(ctx)
+
+	current, err := m.currentVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	collection := m.client.Database(m.dbName).Collection(m.cName)
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := migration.Up(ctx, collection); err != nil {
+			return fmt.Errorf("migrate: applying version %d to %s: %w", migration.Version, m.schemaKey(), err)
+		}
+		if err := m.setVersion(ctx, migration.Version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) schemaKey() string {
+	return m.dbName + ":" + m.cName
+}
+
+func (m *Migrator) locksCollection() *mongo.Collection {
+	return m.client.Database(m.dbName).Collection(locksCollectionName)
+}
+
+func (m *Migrator) migrationsCollection() *mongo.Collection {
+	return m.client.Database(m.dbName).Collection(migrationsCollectionName)
+}
+
+// acquireLock blocks until the advisory lock for this collection is free,
+// polling rather than failing when another instance already holds it: the
+// holder releases it on completion, and the lock's own TTL index reclaims
+// it even if the holder crashed first.
+func (m *Migrator) acquireLock(ctx context.Context) error {
+	for {
+		err := m.tryAcquireLock(ctx)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("migrate: timed out waiting for migration lock on %s: %w", m.schemaKey(), ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+func (m *Migrator) tryAcquireLock(ctx context.Context) error {
+	collection := m.locksCollection()
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "locked_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(lockTTL.Seconds())),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.InsertOne(ctx, bson.M{"_id": m.schemaKey(), "locked_at": time.Now()})
+	return err
+}
+
+func (m *Migrator) releaseLock(ctx context.Context) {
+	_, _ = m.locksCollection().DeleteOne(ctx, bson.M{"_id": m.schemaKey()})
+}
+
+func (m *Migrator) currentVersion(ctx context.Context) (int64, error) {
+	var doc struct {
+		Version int64 `bson:"version"`
+	}
+	err := m.migrationsCollection().FindOne(ctx, bson.M{"_id": m.schemaKey()}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return doc.Version, nil
+}
+
+func (m *Migrator) setVersion(ctx context.Context, version int64) error {
+	filter := bson.M{"_id": m.schemaKey()}
+	update := bson.M{
+		"$set": bson.M{
+			"_id":     m.schemaKey(),
+			"db_name": m.dbName,
+			"c_name":  m.cName,
+			"version": version,
+		},
+	}
+	_, err := m.migrationsCollection().UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	return err
+}
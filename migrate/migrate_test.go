@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	url    = "127.0.0.1:27017"
+	dbName = "mydb_test"
+	cName  = "migrate_test"
+)
+
+func TestMigrator(t *testing.T) {
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://" + url))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := client.Disconnect(context.Background())
+		if err != nil {
+			t.Fatalf("can not disconnect from mongo, due to %v", err)
+		}
+	}()
+
+	Convey("Test Migrator applies pending migrations once and records the version", t, func() {
+		var applied []int64
+		migrations := []Migration{
+			{Version: 2, Up: func(ctx context.Context, collection *mongo.Collection) error {
+				applied = append(applied, 2)
+				return nil
+			}},
+			{Version: 1, Up: func(ctx context.Context, collection *mongo.Collection) error {
+				applied = append(applied, 1)
+				return nil
+			}},
+		}
+
+		migrator := NewMigrator(client, dbName, cName, migrations)
+		So(migrator.Run(context.Background()), ShouldBeNil)
+		So(applied, ShouldResemble, []int64{1, 2})
+
+		version, err := migrator.currentVersion(context.Background())
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, int64(2))
+
+		applied = nil
+		So(migrator.Run(context.Background()), ShouldBeNil)
+		So(applied, ShouldBeEmpty)
+
+		_, err = client.Database(dbName).Collection(migrationsCollectionName).DeleteOne(context.Background(), bson.M{"_id": migrator.schemaKey()})
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestMigratorWaitsOutConcurrentLock(t *testing.T) {
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://" + url))
+	if err != nil {
+		panic(err)
+	}
+	defer func() {
+		err := client.Disconnect(context.Background())
+		if err != nil {
+			t.Fatalf("can not disconnect from mongo, due to %v", err)
+		}
+	}()
+
+	Convey("Test Run waits out a lock held by another instance instead of failing", t, func() {
+		migrator := NewMigrator(client, dbName, "migrate_lock_test", []Migration{
+			{Version: 1, Up: func(ctx context.Context, collection *mongo.Collection) error { return nil }},
+		})
+
+		_, err := migrator.locksCollection().InsertOne(context.Background(), bson.M{"_id": migrator.schemaKey(), "locked_at": time.Now()})
+		So(err, ShouldBeNil)
+
+		done := make(chan error, 1)
+		go func() { done <- migrator.Run(context.Background()) }()
+
+		time.Sleep(3 * lockPollInterval)
+		_, err = migrator.locksCollection().DeleteOne(context.Background(), bson.M{"_id": migrator.schemaKey()})
+		So(err, ShouldBeNil)
+
+		select {
+		case err := <-done:
+			So(err, ShouldBeNil)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run did not return after the lock was released")
+		}
+
+		_, err = client.Database(dbName).Collection(migrationsCollectionName).DeleteOne(context.Background(), bson.M{"_id": migrator.schemaKey()})
+		So(err, ShouldBeNil)
+	})
+}
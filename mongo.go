@@ -2,10 +2,16 @@ package mongo
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/taxime-hq/go-session-mongo/migrate"
 	kmongo "github.com/taxime-hq/kit/mongo"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,174 +26,833 @@ var (
 	jsonUnmarshal                      = jsoniter.Unmarshal
 )
 
-// NewStoreWithClient Create an instance of a mongo store
-func NewStoreWithClient(mongoClient *kmongo.ClientV2, dbName, cName string) session.ManagerStore {
-	return newManagerStore(mongoClient, dbName, cName)
+// Option configures a managerStore created by NewStoreWithClient.
+type Option func(*managerStore)
+
+// WithSerializer overrides how session values are encoded for storage in,
+// and decoded from, the `value` field of a sessionItem. The default is
+// bsonSerializer, which stores values as a native BSON subdocument so
+// individual keys can be queried/indexed as `value.foo`. Pass JSONSerializer{}
+// to keep the legacy JSON-string layout, or supply a custom Serializer to
+// use msgpack/gob/etc.
+func WithSerializer(serializer Serializer) Option {
+	return func(ms *managerStore) {
+		ms.serializer = serializer
+	}
 }
 
-func newManagerStore(mongoClient *kmongo.ClientV2, dbName, cName string) session.ManagerStore {
-	collection := mongoClient.Default.Database(dbName).Collection(cName)
-	indexOptions := options.Index().SetExpireAfterSeconds(1)
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: "expired_at", Value: 1}},
-		Options: indexOptions,
+// WithCollectionNameFunc overrides which collection a tenant's sessions are
+// stored in, keyed by tenant ID. Large installations can use it to shard
+// tenants across collections instead of relying solely on the tenant_id
+// field of a shared collection.
+func WithCollectionNameFunc(fn func(tenantID string) string) Option {
+	return func(ms *managerStore) {
+		ms.collectionNameFunc = fn
+	}
+}
+
+func withFixedTenant(tenantID string) Option {
+	return func(ms *managerStore) {
+		ms.tenantID = tenantID
+	}
+}
+
+// WithAutoMigrate switches index/schema setup from the hardcoded, always-run
+// ensureIndexes behavior to the versioned migrate.Migrator, which records
+// the applied version in a schema_migrations collection. Schema changes
+// introduced after a collection is already in use (new indexes, renamed
+// fields) can then ship as new Migration entries in migrations instead of
+// requiring downtime; existing deployments are seeded at version 1, which
+// reproduces today's hardcoded indexes, so upgrading is non-destructive.
+func WithAutoMigrate(enabled bool) Option {
+	return func(ms *managerStore) {
+		ms.autoMigrate = enabled
+	}
+}
+
+// WithMaxChunkSize enables chunked storage for sessions whose serialized
+// payload exceeds n bytes, keeping individual documents well clear of
+// Mongo's 16MB cap. Oversized payloads are split across documents in a
+// "<collection>_chunks" collection and reassembled on read; n <= 0 (the
+// default) disables chunking.
+func WithMaxChunkSize(n int) Option {
+	return func(ms *managerStore) {
+		ms.maxChunkSize = n
+	}
+}
+
+// WithChangeStreamInvalidation keeps the in-memory values held by a live
+// Store coherent when another process updates the same session, by watching
+// the collection for changes and lazily refreshing on the next Get. Without
+// it, a Store only ever reflects the values it was created or last Saved
+// with, even if another node since overwrote the same sid. It requires the
+// Mongo deployment to be a replica set or sharded cluster; on a standalone
+// deployment it logs once and behaves as if disabled. It cannot be combined
+// with WithCollectionNameFunc: a single change stream watches one
+// collection, so it can't observe writes to tenant collections sharded
+// across many names; newManagerStore panics if both are set.
+func WithChangeStreamInvalidation(enabled bool) Option {
+	return func(ms *managerStore) {
+		ms.changeStreamInvalidation = enabled
 	}
+}
+
+// Serializer controls how session values are marshaled for storage in the
+// `value` field, and unmarshaled back out of it. Marshal returns whatever
+// value should be assigned to `value` in the update document, so a native
+// serializer can return a bson.M while a string-based one returns a string.
+type Serializer interface {
+	Marshal(values map[string]interface{}) (interface{}, error)
+	Unmarshal(raw bson.RawValue) (map[string]interface{}, error)
+}
+
+// bsonSerializer is the default Serializer. It stores session values as a
+// native BSON document and transparently reads back sessions that were
+// written in the legacy JSON-string layout.
+type bsonSerializer struct{}
+
+func (bsonSerializer) Marshal(values map[string]interface{}) (interface{}, error) {
+	return bson.M(values), nil
+}
+
+func (bsonSerializer) Unmarshal(raw bson.RawValue) (map[string]interface{}, error) {
+	switch raw.Type {
+	case bson.TypeString:
+		s := raw.StringValue()
+		if len(s) == 0 {
+			return nil, nil
+		}
+		var values map[string]interface{}
+		if err := jsonUnmarshal([]byte(s), &values); err != nil {
+			return nil, err
+		}
+		return values, nil
+	case bson.TypeEmbeddedDocument:
+		var values bson.M
+		if err := raw.Unmarshal(&values); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}(values), nil
+	default:
+		return nil, nil
+	}
+}
+
+// JSONSerializer stores session values as a JSON-encoded string in the
+// `value` field, matching the layout used before native BSON storage was
+// introduced. Pass it to WithSerializer to keep that layout.
+type JSONSerializer struct{}
 
-	_, err := collection.Indexes().CreateOne(context.Background(), indexModel)
+func (JSONSerializer) Marshal(values map[string]interface{}) (interface{}, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	buf, err := jsonMarshal(values)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return string(buf), nil
+}
+
+func (JSONSerializer) Unmarshal(raw bson.RawValue) (map[string]interface{}, error) {
+	return bsonSerializer{}.Unmarshal(raw)
+}
+
+type tenantContextKey struct{}
+
+// WithTenant scopes ctx to the given tenant ID. Passing the returned context
+// to Create/Update/Refresh/Delete/Check confines those calls to sessions
+// belonging to tenantID. It has no effect on a ManagerStore created with
+// NewStoreWithClientForTenant, which is already pinned to a single tenant.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenantID)
+}
+
+func tenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenantID
+}
+
+// NewStoreWithClient Create an instance of a mongo store
+func NewStoreWithClient(mongoClient *kmongo.ClientV2, dbName, cName string, opts ...Option) session.ManagerStore {
+	return newManagerStore(mongoClient, dbName, cName, opts...)
+}
 
-	return &managerStore{
+// NewStoreWithClientForTenant creates a mongo store pinned to a single
+// tenant. Every session reached through the returned ManagerStore is
+// scoped to tenantID, regardless of any tenant set on the context via
+// WithTenant; use this when a whole service instance serves one tenant.
+func NewStoreWithClientForTenant(mongoClient *kmongo.ClientV2, dbName, cName, tenantID string, opts ...Option) session.ManagerStore {
+	return newManagerStore(mongoClient, dbName, cName, append(opts, withFixedTenant(tenantID))...)
+}
+
+func newManagerStore(mongoClient *kmongo.ClientV2, dbName, cName string, opts ...Option) session.ManagerStore {
+	ms := &managerStore{
 		mongoClient: mongoClient,
 		dbName:      dbName,
 		cName:       cName,
+		serializer:  bsonSerializer{},
+	}
+
+	for _, opt := range opts {
+		opt(ms)
 	}
+
+	if ms.collectionNameFunc != nil && ms.changeStreamInvalidation {
+		panic("go-session-mongo: WithChangeStreamInvalidation cannot be combined with WithCollectionNameFunc; a single change stream cannot watch collections sharded per tenant")
+	}
+
+	// Ensure indexes on the default collection up front, as before; when
+	// WithCollectionNameFunc shards sessions per tenant, each tenant's
+	// collection is indexed lazily the first time it's actually used (see
+	// ensureIndexesOnce), since the set of tenants isn't known up front.
+	ms.collection("")
+
+	if ms.changeStreamInvalidation {
+		ms.registry = newStoreRegistry()
+		ms.startChangeStreamWatch()
+	}
+
+	return ms
+}
+
+// ensureIndexes creates the TTL index used to expire sessions and the
+// compound index used to look up and list a tenant's sessions efficiently.
+// MongoDB requires TTL indexes to be single-field, so tenant scoping for
+// lookups is handled by the separate {tenant_id, _id} index instead of
+// folding tenant_id into the TTL index itself. This reproduces migration
+// version 1 below; it stays as the unconditional default so stores created
+// without WithAutoMigrate keep today's behavior.
+func ensureIndexes(collection *mongo.Collection) {
+	if err := migrationV1(context.Background(), collection); err != nil {
+		panic(err)
+	}
+}
+
+// migrations is the ordered schema history applied by a Migrator when
+// WithAutoMigrate is enabled. Existing deployments are seeded at version 1,
+// which reproduces the indexes ensureIndexes has always created, so turning
+// on auto-migration is non-destructive.
+var migrations = []migrate.Migration{
+	{Version: 1, Up: migrationV1},
+}
+
+func migrationV1(ctx context.Context, collection *mongo.Collection) error {
+	ttlIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expired_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(1),
+	}
+	tenantIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "_id", Value: 1}},
+	}
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{ttlIndex, tenantIndex})
+	return err
 }
 
 type managerStore struct {
-	mongoClient *kmongo.ClientV2
-	dbName      string
-	cName       string
+	mongoClient              *kmongo.ClientV2
+	dbName                   string
+	cName                    string
+	serializer               Serializer
+	tenantID                 string
+	collectionNameFunc       func(tenantID string) string
+	maxChunkSize             int
+	chunkLocks               sync.Map // documentID -> *sync.Mutex, serializes concurrent chunk writes for a sid
+	autoMigrate              bool
+	indexedCollections       sync.Map // collection name -> struct{}, tracks which collections ensureIndexesOnce/ensureChunksIndexesOnce have already run against
+	changeStreamInvalidation bool
+	registry                 *storeRegistry
+	watchCancel              context.CancelFunc
+}
+
+// chunkLock returns the mutex that serializes chunk writes for a session's
+// document ID, so concurrent Save calls for the same sid don't interleave
+// their chunk uploads.
+func (s *managerStore) chunkLock(id string) *sync.Mutex {
+	lock, _ := s.chunkLocks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// deleteChunks removes every chunk document for id, serialized against
+// persistChunked the same way a write would be, and evicts id's entry from
+// chunkLocks once done so a long-running process handling the chunking
+// feature's own stated use case (rotating session IDs, file uploads)
+// doesn't grow that map unbounded.
+func (s *managerStore) deleteChunks(ctx context.Context, tenantID, id string) error {
+	lock := s.chunkLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	defer s.chunkLocks.Delete(id)
+
+	_, err := s.chunksCollection(tenantID).DeleteMany(ctx, bson.M{"sid": id})
+	return err
+}
+
+// tenant resolves the tenant ID that applies to a call made with ctx. A
+// ManagerStore pinned to a tenant via NewStoreWithClientForTenant always
+// wins over whatever WithTenant put on ctx.
+func (s *managerStore) tenant(ctx context.Context) string {
+	if s.tenantID != "" {
+		return s.tenantID
+	}
+	return tenantFromContext(ctx)
+}
+
+// documentID builds the `_id` stored for a session. Sids are only scoped to
+// a tenant in the document key once a tenant is in play, so a single-tenant
+// deployment keeps today's bare-sid `_id` values. tenantID is length-prefixed
+// rather than just joined with a separator, since tenant IDs are arbitrary
+// caller-supplied strings that may themselves contain the separator;
+// documentID("A:B", "s1") and documentID("A", "B:s1") would otherwise both
+// produce "A:B:s1".
+func documentID(tenantID, sid string) string {
+	if tenantID == "" {
+		return sid
+	}
+	return fmt.Sprintf("%d:%s:%s", len(tenantID), tenantID, sid)
 }
 
-func (s *managerStore) getValue(sid string) (string, error) {
+func tenantFilter(tenantID, sid string) bson.M {
+	if tenantID == "" {
+		// Documents written before tenant scoping have no tenant_id field;
+		// matching a missing/null tenant_id as well keeps them reachable.
+		return bson.M{"tenant_id": bson.M{"$in": bson.A{"", nil}}, "_id": sid}
+	}
+	return bson.M{"tenant_id": tenantID, "_id": documentID(tenantID, sid)}
+}
+
+// getValues returns the decoded values for sid along with the rev they were
+// read at, so a Store can later tell whether a change-stream event observed
+// after it was created/refreshed actually supersedes what it's holding.
+func (s *managerStore) getValues(ctx context.Context, sid string) (map[string]interface{}, int64, error) {
+	tenantID := s.tenant(ctx)
 	var item sessionItem
-	err := s.getCollection().FindOne(context.Background(), bson.M{"_id": sid}).Decode(&item)
+	err := s.collection(tenantID).FindOne(context.Background(), tenantFilter(tenantID, sid)).Decode(&item)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return "", nil
+			return nil, 0, nil
 		}
-		return "", err
+		return nil, 0, err
 	} else if item.ExpiredAt.Before(time.Now()) {
-		return "", nil
+		return nil, 0, nil
 	}
-	return item.Value, nil
-}
 
-func (s *managerStore) parseValue(value string) (map[string]interface{}, error) {
-	var values map[string]interface{}
-	if len(value) > 0 {
-		err := jsonUnmarshal([]byte(value), &values)
+	if item.Chunks > 0 {
+		raw, err := s.reassembleChunks(tenantID, documentID(tenantID, sid), item)
 		if err != nil {
+			return nil, 0, err
+		}
+		var wrapper struct {
+			V bson.RawValue `bson:"v"`
+		}
+		if err := bson.Unmarshal(raw, &wrapper); err != nil {
+			return nil, 0, err
+		}
+		values, err := s.serializer.Unmarshal(wrapper.V)
+		return values, item.Rev, err
+	}
+
+	values, err := s.serializer.Unmarshal(item.Value)
+	return values, item.Rev, err
+}
+
+// reassembleChunks reads back, in order, the chunks written by
+// persistChunked for id, and verifies them against the manifest recorded on
+// item before returning the reassembled payload.
+func (s *managerStore) reassembleChunks(tenantID, id string, item sessionItem) ([]byte, error) {
+	cursor, err := s.chunksCollection(tenantID).Find(
+		context.Background(),
+		bson.M{"sid": id},
+		options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	payload := make([]byte, 0, item.TotalSize)
+	seen := 0
+	for cursor.Next(context.Background()) {
+		var chunk sessionChunk
+		if err := cursor.Decode(&chunk); err != nil {
 			return nil, err
 		}
+		payload = append(payload, chunk.Data...)
+		seen++
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if seen != item.Chunks {
+		return nil, fmt.Errorf("go-session-mongo: session %q expects %d chunks, found %d", id, item.Chunks, seen)
 	}
 
-	return values, nil
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != item.Checksum {
+		return nil, fmt.Errorf("go-session-mongo: checksum mismatch reassembling chunks for session %q", id)
+	}
+
+	return payload, nil
 }
 
-func (s *managerStore) Check(_ context.Context, sid string) (bool, error) {
-	val, err := s.getValue(sid)
+func (s *managerStore) Check(ctx context.Context, sid string) (bool, error) {
+	values, _, err := s.getValues(ctx, sid)
 	if err != nil {
 		return false, err
 	}
-	return val != "", nil
+	return len(values) > 0, nil
 }
 
 // Create(ctx context.Context, sid string, expired int64) (Store, error)
 func (s *managerStore) Create(ctx context.Context, sid string, expired int64) (session.Store, error) {
-	return newStore(ctx, s, sid, expired, nil), nil
+	return newStore(ctx, s, sid, expired, nil, 0), nil
 }
 
 func (s *managerStore) Update(ctx context.Context, sid string, expired int64) (session.Store, error) {
-	value, err := s.getValue(sid)
+	values, rev, err := s.getValues(ctx, sid)
 	if err != nil {
 		return nil, err
-	} else if value == "" {
-		return newStore(ctx, s, sid, expired, nil), nil
+	} else if len(values) == 0 {
+		return newStore(ctx, s, sid, expired, nil, 0), nil
 	}
-	filter := bson.M{"_id": sid}
+	tenantID := s.tenant(ctx)
+	expiredAt := time.Now().Add(time.Duration(expired) * time.Second)
 	update := bson.M{
 		"$set": bson.M{
-			"expired_at": time.Now().Add(time.Duration(expired) * time.Second),
+			"expired_at": expiredAt,
 		},
 	}
-	_, err = s.getCollection().UpdateOne(context.Background(), filter, update)
+	_, err = s.collection(tenantID).UpdateOne(context.Background(), tenantFilter(tenantID, sid), update)
 	if err != nil {
 		return nil, err
 	}
-
-	values, err := s.parseValue(value)
+	// Extend a chunked session's chunks too, so their TTL keeps pace with the
+	// parent sessionItem.
+	chunksUpdate := bson.M{"$set": bson.M{"expired_at": expiredAt}}
+	_, err = s.chunksCollection(tenantID).UpdateMany(context.Background(), bson.M{"sid": documentID(tenantID, sid)}, chunksUpdate)
 	if err != nil {
 		return nil, err
 	}
 
-	return newStore(ctx, s, sid, expired, values), nil
+	return newStore(ctx, s, sid, expired, values, rev), nil
 }
 
-func (s *managerStore) Delete(_ context.Context, sid string) error {
-	_, err := s.getCollection().DeleteOne(context.Background(), bson.M{"_id": sid})
-	return err
+func (s *managerStore) Delete(ctx context.Context, sid string) error {
+	tenantID := s.tenant(ctx)
+	id := documentID(tenantID, sid)
+	return s.withTransaction(func(txCtx context.Context) error {
+		if err := s.deleteChunks(txCtx, tenantID, id); err != nil {
+			return err
+		}
+		_, err := s.collection(tenantID).DeleteOne(txCtx, tenantFilter(tenantID, sid))
+		return err
+	})
 }
 
 func (s *managerStore) Refresh(ctx context.Context, oldsid, sid string, expired int64) (session.Store, error) {
-	value, err := s.getValue(oldsid)
+	values, _, err := s.getValues(ctx, oldsid)
 	if err != nil {
 		return nil, err
-	} else if value == "" {
-		return newStore(ctx, s, sid, expired, nil), nil
+	} else if len(values) == 0 {
+		return newStore(ctx, s, sid, expired, nil, 0), nil
+	}
+
+	tenantID := s.tenant(ctx)
+	if err := s.persist(tenantID, sid, expired, values); err != nil {
+		return nil, err
+	}
+
+	oldID := documentID(tenantID, oldsid)
+	err = s.withTransaction(func(txCtx context.Context) error {
+		if err := s.deleteChunks(txCtx, tenantID, oldID); err != nil {
+			return err
+		}
+		_, err := s.collection(tenantID).DeleteOne(txCtx, tenantFilter(tenantID, oldsid))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.registry != nil {
+		s.registry.remove(oldID)
+	}
+
+	return newStore(ctx, s, sid, expired, values, 1), nil
+}
+
+// persist marshals values and writes them as the session named sid,
+// transparently chunking the payload across the "<collection>_chunks"
+// collection when it exceeds maxChunkSize.
+func (s *managerStore) persist(tenantID, sid string, expired int64, values map[string]interface{}) error {
+	value, err := s.serializer.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	if s.maxChunkSize > 0 {
+		payload, err := bson.Marshal(bson.M{"v": value})
+		if err != nil {
+			return err
+		}
+		if len(payload) > s.maxChunkSize {
+			return s.persistChunked(tenantID, sid, expired, payload)
+		}
 	}
-	filterNew := bson.M{"_id": sid}
+
+	return s.persistInline(tenantID, sid, expired, value)
+}
+
+func (s *managerStore) persistInline(tenantID, sid string, expired int64, value interface{}) error {
+	id := documentID(tenantID, sid)
+	if err := s.deleteChunks(context.Background(), tenantID, id); err != nil {
+		return err
+	}
+
 	update := bson.M{
 		"$set": bson.M{
-			"_id":        sid,
+			"_id":        id,
+			"tenant_id":  tenantID,
 			"value":      value,
 			"expired_at": time.Now().Add(time.Duration(expired) * time.Second),
 		},
+		"$unset": bson.M{"chunks": "", "total_size": "", "checksum": ""},
+		"$inc":   bson.M{"rev": int64(1)},
 	}
-	_, err = s.getCollection().UpdateOne(ctx, filterNew, update, options.UpdateOne().SetUpsert(true))
-	if err != nil {
-		return nil, err
+	_, err := s.collection(tenantID).UpdateOne(context.Background(), tenantFilter(tenantID, sid), update, options.UpdateOne().SetUpsert(true))
+	return err
+}
+
+// persistChunked splits payload across numbered documents in the
+// "<collection>_chunks" collection and records a manifest (chunk count,
+// total size, checksum) on the main sessionItem in place of `value`. Writes
+// for a given sid are serialized via chunkLock, and run inside a Mongo
+// transaction when the deployment supports them so a reader never observes
+// a manifest pointing at a partially-written chunk set.
+func (s *managerStore) persistChunked(tenantID, sid string, expired int64, payload []byte) error {
+	id := documentID(tenantID, sid)
+
+	lock := s.chunkLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	numChunks := (len(payload) + s.maxChunkSize - 1) / s.maxChunkSize
+	sum := sha256.Sum256(payload)
+	checksum := hex.EncodeToString(sum[:])
+	expiredAt := time.Now().Add(time.Duration(expired) * time.Second)
+
+	write := func(ctx context.Context) error {
+		chunksCollection := s.chunksCollection(tenantID)
+		for seq := 0; seq < numChunks; seq++ {
+			start := seq * s.maxChunkSize
+			end := start + s.maxChunkSize
+			if end > len(payload) {
+				end = len(payload)
+			}
+			filter := bson.M{"sid": id, "seq": seq}
+			update := bson.M{"$set": bson.M{"sid": id, "seq": seq, "data": payload[start:end], "expired_at": expiredAt}}
+			if _, err := chunksCollection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true)); err != nil {
+				return err
+			}
+		}
+		if _, err := chunksCollection.DeleteMany(ctx, bson.M{"sid": id, "seq": bson.M{"$gte": numChunks}}); err != nil {
+			return err
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"_id":        id,
+				"tenant_id":  tenantID,
+				"chunks":     numChunks,
+				"total_size": len(payload),
+				"checksum":   checksum,
+				"expired_at": expiredAt,
+			},
+			"$unset": bson.M{"value": ""},
+			"$inc":   bson.M{"rev": int64(1)},
+		}
+		_, err := s.collection(tenantID).UpdateOne(ctx, tenantFilter(tenantID, sid), update, options.UpdateOne().SetUpsert(true))
+		return err
 	}
 
-	filterOld := bson.M{"_id": oldsid}
-	_, err = s.getCollection().DeleteOne(ctx, filterOld)
+	return s.withTransaction(write)
+}
+
+// withTransaction runs fn inside a Mongo transaction when the deployment
+// supports them, so callers that perform several related writes (chunked
+// payload writes, chunk+document deletes) never leave them partially
+// applied. On a standalone deployment, which rejects transactions outright,
+// it falls back to running fn directly without atomicity.
+func (s *managerStore) withTransaction(fn func(ctx context.Context) error) error {
+	mongoSession, err := s.mongoClient.Default.StartSession()
 	if err != nil {
-		return nil, err
+		return fn(context.Background())
+	}
+	defer mongoSession.EndSession(context.Background())
+
+	_, err = mongoSession.WithTransaction(context.Background(), func(sctx context.Context) (interface{}, error) {
+		return nil, fn(sctx)
+	})
+	if err != nil && isTransactionsUnsupported(err) {
+		warnTransactionsUnsupportedOnce()
+		return fn(context.Background())
 	}
+	return err
+}
 
-	values, err := s.parseValue(value)
-	if err != nil {
-		return nil, err
+var transactionsUnsupportedWarnOnce sync.Once
+
+// isTransactionsUnsupported reports whether err looks like the deployment
+// isn't a replica set/mongos, the only case where Mongo rejects transactions
+// outright; any other error is a real write failure and must propagate.
+func isTransactionsUnsupported(err error) bool {
+	return strings.Contains(err.Error(), "Transaction numbers")
+}
+
+func warnTransactionsUnsupportedOnce() {
+	transactionsUnsupportedWarnOnce.Do(func() {
+		log.Println("go-session-mongo: mongo deployment does not support transactions; writing session chunks without atomicity")
+	})
+}
+
+func (s *managerStore) collection(tenantID string) *mongo.Collection {
+	name := s.collectionName(tenantID)
+	collection := s.mongoClient.Default.Database(s.dbName).Collection(name)
+	s.ensureIndexesOnce(name, collection)
+	return collection
+}
+
+func (s *managerStore) collectionName(tenantID string) string {
+	if s.collectionNameFunc != nil {
+		return s.collectionNameFunc(tenantID)
 	}
+	return s.cName
+}
 
-	return newStore(ctx, s, sid, expired, values), nil
+// ensureIndexesOnce sets up indexes for a collection the first time it's
+// actually used. With WithCollectionNameFunc sharding sessions per tenant,
+// collection(tenantID) can resolve to a different collection per tenant, and
+// the set of tenants isn't known up front, so indexes can't all be created
+// eagerly in newManagerStore; this runs the same setup lazily, once per
+// distinct collection name.
+func (s *managerStore) ensureIndexesOnce(name string, collection *mongo.Collection) {
+	if _, loaded := s.indexedCollections.LoadOrStore(name, struct{}{}); loaded {
+		return
+	}
+	if s.autoMigrate {
+		migrator := migrate.NewMigrator(s.mongoClient.Default, s.dbName, name, migrations)
+		if err := migrator.Run(context.Background()); err != nil {
+			panic(err)
+		}
+	} else {
+		ensureIndexes(collection)
+	}
 }
 
-func (s *managerStore) getCollection() *mongo.Collection {
-	return s.mongoClient.Default.Database(s.dbName).Collection(s.cName)
+// chunksCollection holds the auxiliary documents a large session's payload
+// is split across; see persistChunked and reassembleChunks. Its own TTL
+// index (see ensureChunksIndexesOnce) expires a sid's chunks around the same
+// time as its parent sessionItem, so chunks are reclaimed even for sessions
+// that simply expire instead of being removed through Delete/Refresh.
+func (s *managerStore) chunksCollection(tenantID string) *mongo.Collection {
+	name := s.collectionName(tenantID) + "_chunks"
+	collection := s.mongoClient.Default.Database(s.dbName).Collection(name)
+	s.ensureChunksIndexesOnce(name, collection)
+	return collection
+}
+
+// ensureChunksIndexesOnce creates the chunks collection's TTL index the
+// first time a given chunks collection is used; see chunksCollection.
+func (s *managerStore) ensureChunksIndexesOnce(name string, collection *mongo.Collection) {
+	if _, loaded := s.indexedCollections.LoadOrStore(name, struct{}{}); loaded {
+		return
+	}
+	ttlIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expired_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(1),
+	}
+	if _, err := collection.Indexes().CreateOne(context.Background(), ttlIndex); err != nil {
+		panic(err)
+	}
 }
 
 func (s *managerStore) Close() error {
+	if s.watchCancel != nil {
+		s.watchCancel()
+	}
 	return nil
 }
 
-func newStore(ctx context.Context, s *managerStore, sid string, expired int64, values map[string]interface{}) session.Store {
+// startChangeStreamWatch opens a change stream over the session collection
+// and invalidates registry entries as events for other writers arrive. Mongo
+// only supports change streams against a replica set or sharded cluster, so
+// a standalone deployment's Watch call fails here; that's treated as
+// unsupported rather than fatal, logged once, and left disabled.
+func (s *managerStore) startChangeStreamWatch() {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.M{
+			"operationType": bson.M{"$in": bson.A{"update", "replace", "delete"}},
+		}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := s.collection("").Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		cancel()
+		warnChangeStreamsUnsupportedOnce()
+		return
+	}
+
+	s.watchCancel = cancel
+	go s.watchChangeStream(ctx, stream)
+}
+
+func (s *managerStore) watchChangeStream(ctx context.Context, stream *mongo.ChangeStream) {
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event struct {
+			OperationType string `bson:"operationType"`
+			DocumentKey   struct {
+				ID string `bson:"_id"`
+			} `bson:"documentKey"`
+			FullDocument sessionItem `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			continue
+		}
+
+		if event.OperationType == "delete" {
+			s.registry.remove(event.DocumentKey.ID)
+			continue
+		}
+		s.registry.invalidate(event.DocumentKey.ID, event.FullDocument.Rev)
+	}
+}
+
+var changeStreamsUnsupportedWarnOnce sync.Once
+
+func warnChangeStreamsUnsupportedOnce() {
+	changeStreamsUnsupportedWarnOnce.Do(func() {
+		log.Println("go-session-mongo: mongo deployment does not support change streams; change-stream invalidation is disabled")
+	})
+}
+
+// storeRegistry tracks the live *store instances for a managerStore with
+// WithChangeStreamInvalidation enabled, keyed by document ID, so a
+// change-stream event for a sid can invalidate every Store holding it.
+type storeRegistry struct {
+	mu      sync.Mutex
+	entries map[string]map[*store]struct{}
+}
+
+func newStoreRegistry() *storeRegistry {
+	return &storeRegistry{entries: make(map[string]map[*store]struct{})}
+}
+
+func (r *storeRegistry) add(id string, st *store) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stores, ok := r.entries[id]
+	if !ok {
+		stores = make(map[*store]struct{})
+		r.entries[id] = stores
+	}
+	stores[st] = struct{}{}
+}
+
+func (r *storeRegistry) invalidate(id string, rev int64) {
+	r.mu.Lock()
+	stores := make([]*store, 0, len(r.entries[id]))
+	for st := range r.entries[id] {
+		stores = append(stores, st)
+	}
+	r.mu.Unlock()
+
+	for _, st := range stores {
+		st.invalidate(rev)
+	}
+}
+
+// remove drops every Store tracked for id, e.g. because the document was
+// deleted or refreshed onto a new sid, so the registry doesn't grow
+// unbounded as sessions churn.
+func (r *storeRegistry) remove(id string) {
+	r.mu.Lock()
+	delete(r.entries, id)
+	r.mu.Unlock()
+}
+
+func newStore(ctx context.Context, s *managerStore, sid string, expired int64, values map[string]interface{}, rev int64) session.Store {
 	if values == nil {
 		values = make(map[string]interface{})
 	}
 
-	return &store{
-		mongoClient: s.mongoClient,
-		dbName:      s.dbName,
-		cName:       s.cName,
-		ctx:         ctx,
-		sid:         sid,
-		expired:     expired,
-		values:      values,
+	st := &store{
+		managerStore: s,
+		ctx:          ctx,
+		sid:          sid,
+		tenantID:     s.tenant(ctx),
+		expired:      expired,
+		values:       values,
+		rev:          rev,
 	}
+
+	if s.changeStreamInvalidation {
+		s.registry.add(documentID(st.tenantID, sid), st)
+	}
+
+	return st
 }
 
 type store struct {
 	sync.RWMutex
-	ctx         context.Context
-	mongoClient *kmongo.ClientV2
-	dbName      string
-	cName       string
-	sid         string
-	expired     int64
-	values      map[string]interface{}
+	ctx          context.Context
+	managerStore *managerStore
+	sid          string
+	tenantID     string
+	expired      int64
+	values       map[string]interface{}
+	rev          int64
+	invalidated  bool
+}
+
+// invalidate marks the store's cached values as stale if remoteRev is newer
+// than what this store last read or wrote, so a refresh is picked up on the
+// next Get instead of returning values another writer has since overwritten.
+func (s *store) invalidate(remoteRev int64) {
+	s.Lock()
+	if remoteRev > s.rev {
+		s.invalidated = true
+	}
+	s.Unlock()
+}
+
+// refreshIfInvalidated re-reads values from Mongo if a change-stream event
+// has marked this store stale. Failures are swallowed best-effort: Get has
+// no error return, and the store simply keeps serving its last known values
+// until a later refresh succeeds.
+func (s *store) refreshIfInvalidated() {
+	s.RLock()
+	invalidated := s.invalidated
+	s.RUnlock()
+	if !invalidated {
+		return
+	}
+
+	values, rev, err := s.managerStore.getValues(s.ctx, s.sid)
+	if err != nil {
+		return
+	}
+
+	s.Lock()
+	s.invalidated = false
+	if values != nil {
+		s.values = values
+		s.rev = rev
+	}
+	s.Unlock()
 }
 
 func (s *store) Context() context.Context {
@@ -205,6 +870,10 @@ func (s *store) Set(key string, value interface{}) {
 }
 
 func (s *store) Get(key string) (interface{}, bool) {
+	if s.managerStore.changeStreamInvalidation {
+		s.refreshIfInvalidated()
+	}
+
 	s.RLock()
 	val, ok := s.values[key]
 	s.RUnlock()
@@ -231,34 +900,43 @@ func (s *store) Flush() error {
 }
 
 func (s *store) Save() error {
-	var value string
-
 	s.RLock()
-	if len(s.values) > 0 {
-		buf, err := jsonMarshal(s.values)
-		if err != nil {
-			s.RUnlock()
-			return err
-		}
-		value = string(buf)
+	values := make(map[string]interface{}, len(s.values))
+	for k, v := range s.values {
+		values[k] = v
 	}
 	s.RUnlock()
-	filter := bson.M{"_id": s.sid}
-	update := bson.M{
-		"$set": bson.M{
-			"_id":        s.sid,
-			"value":      value,
-			"expired_at": time.Now().Add(time.Duration(s.expired) * time.Second),
-		},
+
+	if err := s.managerStore.persist(s.tenantID, s.sid, s.expired, values); err != nil {
+		return err
 	}
-	_, err := s.mongoClient.Default.Database(s.dbName).Collection(s.cName).UpdateOne(context.Background(), filter, update, options.UpdateOne().SetUpsert(true))
 
-	return err
+	s.Lock()
+	s.rev++
+	s.invalidated = false
+	s.Unlock()
+	return nil
 }
 
-// Data items stored in mongo
+// Data items stored in mongo. Large payloads are chunked: Value is absent
+// and Chunks/TotalSize/Checksum describe the pieces in the "<collection>_chunks"
+// collection; see persistChunked and reassembleChunks.
 type sessionItem struct {
-	ID        string    `bson:"_id"`
-	Value     string    `bson:"value"`
+	ID        string        `bson:"_id"`
+	TenantID  string        `bson:"tenant_id"`
+	Value     bson.RawValue `bson:"value,omitempty"`
+	Chunks    int           `bson:"chunks,omitempty"`
+	TotalSize int           `bson:"total_size,omitempty"`
+	Checksum  string        `bson:"checksum,omitempty"`
+	ExpiredAt time.Time     `bson:"expired_at"`
+	Rev       int64         `bson:"rev"`
+}
+
+// sessionChunk is one piece of a chunked session payload, written by
+// persistChunked and reassembled by reassembleChunks.
+type sessionChunk struct {
+	Sid       string    `bson:"sid"`
+	Seq       int       `bson:"seq"`
+	Data      []byte    `bson:"data"`
 	ExpiredAt time.Time `bson:"expired_at"`
 }
@@ -2,7 +2,9 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	kmongo "github.com/taxime-hq/kit/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"log"
 	"testing"
 	"time"
@@ -125,3 +127,97 @@ func TestManagerStore(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 }
+
+func TestSerializers(t *testing.T) {
+	Convey("Test bsonSerializer round-trips native values and reads legacy JSON strings", t, func() {
+		values := map[string]interface{}{"foo": "bar"}
+
+		raw, err := bsonSerializer{}.Marshal(values)
+		So(err, ShouldBeNil)
+		doc, err := bson.Marshal(bson.M{"value": raw})
+		So(err, ShouldBeNil)
+		var item sessionItem
+		So(bson.Unmarshal(doc, &item), ShouldBeNil)
+
+		decoded, err := bsonSerializer{}.Unmarshal(item.Value)
+		So(err, ShouldBeNil)
+		So(decoded["foo"], ShouldEqual, "bar")
+
+		legacyDoc, err := bson.Marshal(bson.M{"value": "{\"foo\":\"bar\"}"})
+		So(err, ShouldBeNil)
+		var legacyItem sessionItem
+		So(bson.Unmarshal(legacyDoc, &legacyItem), ShouldBeNil)
+
+		decodedLegacy, err := bsonSerializer{}.Unmarshal(legacyItem.Value)
+		So(err, ShouldBeNil)
+		So(decodedLegacy["foo"], ShouldEqual, "bar")
+	})
+
+	Convey("Test JSONSerializer keeps the legacy JSON-string layout", t, func() {
+		values := map[string]interface{}{"foo": "bar"}
+
+		raw, err := JSONSerializer{}.Marshal(values)
+		So(err, ShouldBeNil)
+		So(raw, ShouldEqual, "{\"foo\":\"bar\"}")
+	})
+}
+
+func TestTenantScoping(t *testing.T) {
+	Convey("Test tenant resolution and document IDs prevent cross-tenant sid collisions", t, func() {
+		pinned := &managerStore{tenantID: "tenant-a"}
+		So(pinned.tenant(context.Background()), ShouldEqual, "tenant-a")
+		So(pinned.tenant(WithTenant(context.Background(), "tenant-b")), ShouldEqual, "tenant-a")
+
+		unpinned := &managerStore{}
+		So(unpinned.tenant(context.Background()), ShouldEqual, "")
+		So(unpinned.tenant(WithTenant(context.Background(), "tenant-b")), ShouldEqual, "tenant-b")
+
+		So(documentID("", "sid1"), ShouldEqual, "sid1")
+		So(documentID("tenant-a", "sid1"), ShouldEqual, "8:tenant-a:sid1")
+		So(documentID("tenant-b", "sid1"), ShouldNotEqual, documentID("tenant-a", "sid1"))
+
+		// Length-prefixing keeps tenantID and sid unambiguous even when one
+		// contains the ":" separator, unlike naive concatenation where
+		// documentID("A:B", "s1") and documentID("A", "B:s1") would collide.
+		So(documentID("A:B", "s1"), ShouldNotEqual, documentID("A", "B:s1"))
+	})
+}
+
+func TestIsTransactionsUnsupported(t *testing.T) {
+	Convey("Test detection of the standalone-deployment transaction error", t, func() {
+		So(isTransactionsUnsupported(errors.New("Transaction numbers are only allowed on a replica set member or mongos")), ShouldBeTrue)
+		So(isTransactionsUnsupported(errors.New("connection refused")), ShouldBeFalse)
+	})
+}
+
+func TestChunkLockEviction(t *testing.T) {
+	Convey("Test evicting a chunkLocks entry frees its id for reuse instead of growing the map forever", t, func() {
+		ms := &managerStore{}
+		id := "sid1"
+		lockBefore := ms.chunkLock(id)
+
+		ms.chunkLocks.Delete(id)
+
+		lockAfter := ms.chunkLock(id)
+		So(lockAfter, ShouldNotEqual, lockBefore)
+	})
+}
+
+func TestStoreRegistryInvalidation(t *testing.T) {
+	Convey("Test change-stream events invalidate only stores behind the observed rev", t, func() {
+		registry := newStoreRegistry()
+		st := &store{rev: 1}
+		registry.add("sid1", st)
+
+		registry.invalidate("sid1", 1)
+		So(st.invalidated, ShouldBeFalse)
+
+		registry.invalidate("sid1", 2)
+		So(st.invalidated, ShouldBeTrue)
+
+		st.invalidated = false
+		registry.remove("sid1")
+		registry.invalidate("sid1", 3)
+		So(st.invalidated, ShouldBeFalse)
+	})
+}